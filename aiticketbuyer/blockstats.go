@@ -0,0 +1,147 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import (
+	"sort"
+
+	"github.com/HcashOrg/hcd/chaincfg/chainhash"
+	"github.com/HcashOrg/hcd/hcutil"
+)
+
+// blockStatsPercentiles is the set of feerate percentiles reported by
+// BlockStats, mirroring dcrd's getblockstats RPC.
+var blockStatsPercentiles = []float64{10, 25, 50, 75, 90}
+
+// BlockStats holds per-block aggregates computed in a single pass over a
+// block's transactions: min/max/mean/median feerate, a handful of feerate
+// percentiles, basic counts, and the ticket-only mean/median feerate. It
+// is the cross-cutting stats layer that feeds findTicketFeeBlocks,
+// findVWAPTicketFee, and EstimateFeePercentiles so that none of them need
+// their own walk over GetBlock's transactions.
+type BlockStats struct {
+	Hash               chainhash.Hash
+	Height             int64
+	Txs                int
+	Ins                int
+	Outs               int
+	TotalSize          int64
+	MinFeeRate         hcutil.Amount
+	MaxFeeRate         hcutil.Amount
+	MeanFeeRate        hcutil.Amount
+	MedianFeeRate      hcutil.Amount
+	FeeRatePercentiles map[float64]hcutil.Amount
+
+	// TicketMeanFeeRate and TicketMedianFeeRate are the mean/median
+	// feerate of ticket purchases (SStx) only. Ticket purchases pay into
+	// a different fee market than regular sends/votes/revocations, so
+	// findTicketFeeBlocks must use these rather than the all-transaction
+	// fields above.
+	TicketMeanFeeRate   hcutil.Amount
+	TicketMedianFeeRate hcutil.Amount
+}
+
+// blockStats computes BlockStats for the block at height. It first calls
+// t.feeHistoryCacheEntry, which validates the height's current hash and
+// already walks the block once (via GetBlock) to compute fee weights; it
+// then returns the t.blockStatsCache entry if that hash still matches, and
+// otherwise derives everything from the feeHistoryCacheEntry result. blockStats adds no GetBlock call of its own so
+// that a height is only ever fetched from the chain a single time, no
+// matter how many of findTicketFeeBlocks/findVWAPTicketFee/
+// EstimateFeePercentiles end up needing its stats.
+func (t *TicketPurchaser) blockStats(height int64) (*BlockStats, error) {
+	if t.blockStatsCache == nil {
+		t.blockStatsCache = make(map[int64]*BlockStats)
+	}
+	if height > t.blockStatsCacheMaxHeight {
+		t.blockStatsCacheMaxHeight = height
+	}
+	pruneBlockStatsCache(t.blockStatsCache, t.blockStatsCacheMaxHeight)
+
+	entry, err := t.feeHistoryCacheEntry(height)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached, ok := t.blockStatsCache[height]; ok && cached.Hash == entry.hash {
+		return cached, nil
+	}
+
+	stats := aggregateBlockStats(entry)
+	t.blockStatsCache[height] = stats
+	return stats, nil
+}
+
+// aggregateBlockStats computes the percentile/mean/median feerate fields of
+// BlockStats from an already-fetched feeHistoryBlock. It touches neither the
+// chain nor t.blockStatsCache, so the aggregation math can be exercised
+// directly in tests without a mock RPC client.
+func aggregateBlockStats(entry *feeHistoryBlock) *BlockStats {
+	stats := &BlockStats{
+		Hash:               entry.hash,
+		Height:             entry.height,
+		Txs:                entry.txs,
+		Ins:                entry.ins,
+		Outs:               entry.outs,
+		FeeRatePercentiles: make(map[float64]hcutil.Amount, len(blockStatsPercentiles)),
+	}
+
+	sorted := make(feeWeights, len(entry.fees))
+	copy(sorted, entry.fees)
+	sort.Sort(sorted)
+
+	if len(sorted) == 0 {
+		return stats
+	}
+
+	var sum hcutil.Amount
+	var totalSize int64
+	for _, fw := range sorted {
+		sum += fw.feePerKB
+		totalSize += fw.size
+	}
+	stats.TotalSize = totalSize
+	stats.MinFeeRate = sorted[0].feePerKB
+	stats.MaxFeeRate = sorted[len(sorted)-1].feePerKB
+	stats.MeanFeeRate = sum / hcutil.Amount(len(sorted))
+	stats.MedianFeeRate = sorted[len(sorted)/2].feePerKB
+
+	for _, p := range blockStatsPercentiles {
+		idx := int(p / 100 * float64(len(sorted)))
+		if idx >= len(sorted) {
+			idx = len(sorted) - 1
+		}
+		stats.FeeRatePercentiles[p] = sorted[idx].feePerKB
+	}
+
+	if len(entry.ticketFees) > 0 {
+		ticketSorted := make(feeWeights, len(entry.ticketFees))
+		copy(ticketSorted, entry.ticketFees)
+		sort.Sort(ticketSorted)
+
+		var ticketSum hcutil.Amount
+		for _, fw := range ticketSorted {
+			ticketSum += fw.feePerKB
+		}
+		stats.TicketMeanFeeRate = ticketSum / hcutil.Amount(len(ticketSorted))
+		stats.TicketMedianFeeRate = ticketSorted[len(ticketSorted)/2].feePerKB
+	}
+
+	return stats
+}
+
+// pruneBlockStatsCache evicts any entry keyed below
+// maxHeight-windowsToConsider, mirroring pruneHeightCache for
+// t.feeHistoryCache, so t.blockStatsCache doesn't grow without bound over
+// the life of a long-running ticket buyer.
+func pruneBlockStatsCache(cache map[int64]*BlockStats, maxHeight int64) {
+	cutoff := maxHeight - windowsToConsider
+	for h := range cache {
+		if h < cutoff {
+			delete(cache, h)
+		}
+	}
+}
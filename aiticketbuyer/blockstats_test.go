@@ -0,0 +1,122 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import (
+	"testing"
+
+	"github.com/HcashOrg/hcd/hcutil"
+)
+
+func TestAggregateBlockStats(t *testing.T) {
+	tests := []struct {
+		name            string
+		entry           *feeHistoryBlock
+		wantMin         hcutil.Amount
+		wantMax         hcutil.Amount
+		wantMean        hcutil.Amount
+		wantMedian      hcutil.Amount
+		wantTicketMean  hcutil.Amount
+		wantTicketMedia hcutil.Amount
+	}{
+		{
+			name: "no transactions",
+			entry: &feeHistoryBlock{
+				height: 100,
+				txs:    1,
+			},
+		},
+		{
+			name: "mix of regular and ticket fees",
+			entry: &feeHistoryBlock{
+				height: 200,
+				txs:    6,
+				ins:    7,
+				outs:   9,
+				fees: feeWeights{
+					{feePerKB: 10, size: 250},
+					{feePerKB: 20, size: 250},
+					{feePerKB: 30, size: 250},
+				},
+				ticketFees: feeWeights{
+					{feePerKB: 40, size: 250},
+					{feePerKB: 60, size: 250},
+				},
+			},
+			wantMin:         10,
+			wantMax:         30,
+			wantMean:        20,
+			wantMedian:      20,
+			wantTicketMean:  50,
+			wantTicketMedia: 60,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats := aggregateBlockStats(test.entry)
+			if stats.Height != test.entry.height {
+				t.Errorf("got height %v, want %v", stats.Height, test.entry.height)
+			}
+			// Txs/Ins/Outs must come straight from the feeHistoryBlock
+			// already fetched by feeHistoryCacheEntry: aggregateBlockStats
+			// must never make its own GetBlock call to recompute them.
+			if stats.Txs != test.entry.txs {
+				t.Errorf("got txs %v, want %v", stats.Txs, test.entry.txs)
+			}
+			if stats.Ins != test.entry.ins {
+				t.Errorf("got ins %v, want %v", stats.Ins, test.entry.ins)
+			}
+			if stats.Outs != test.entry.outs {
+				t.Errorf("got outs %v, want %v", stats.Outs, test.entry.outs)
+			}
+			if stats.MinFeeRate != test.wantMin {
+				t.Errorf("got min %v, want %v", stats.MinFeeRate, test.wantMin)
+			}
+			if stats.MaxFeeRate != test.wantMax {
+				t.Errorf("got max %v, want %v", stats.MaxFeeRate, test.wantMax)
+			}
+			if stats.MeanFeeRate != test.wantMean {
+				t.Errorf("got mean %v, want %v", stats.MeanFeeRate, test.wantMean)
+			}
+			if stats.MedianFeeRate != test.wantMedian {
+				t.Errorf("got median %v, want %v", stats.MedianFeeRate, test.wantMedian)
+			}
+			if stats.TicketMeanFeeRate != test.wantTicketMean {
+				t.Errorf("got ticket mean %v, want %v", stats.TicketMeanFeeRate, test.wantTicketMean)
+			}
+			if stats.TicketMedianFeeRate != test.wantTicketMedia {
+				t.Errorf("got ticket median %v, want %v", stats.TicketMedianFeeRate, test.wantTicketMedia)
+			}
+		})
+	}
+}
+
+func TestPruneBlockStatsCache(t *testing.T) {
+	cache := map[int64]*BlockStats{
+		50:  {Height: 50},
+		79:  {Height: 79},
+		80:  {Height: 80},
+		100: {Height: 100},
+	}
+
+	// maxHeight=100 with windowsToConsider=20 means a cutoff of 80:
+	// anything below that has aged out of the window of interest.
+	pruneBlockStatsCache(cache, 100)
+
+	if _, ok := cache[50]; ok {
+		t.Errorf("height 50 should have been pruned")
+	}
+	if _, ok := cache[79]; ok {
+		t.Errorf("height 79 should have been pruned")
+	}
+	if _, ok := cache[80]; !ok {
+		t.Errorf("height 80 is exactly at the cutoff and should remain")
+	}
+	if _, ok := cache[100]; !ok {
+		t.Errorf("the current height should remain")
+	}
+}
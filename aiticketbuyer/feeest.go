@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/HcashOrg/hcd/chaincfg/chainhash"
 	"github.com/HcashOrg/hcd/hcutil"
 )
 
@@ -37,12 +38,128 @@ func (p diffPeriodFees) Less(i, j int) bool {
 }
 func (p diffPeriodFees) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
 
+// feeWindowDiff caches the difficulty (SBits) of the block at a window's
+// start height, along with the hash it was read from.
+type feeWindowDiff struct {
+	hash          chainhash.Hash
+	windowDiffAmt hcutil.Amount
+}
+
+// windowDifficulty returns the difficulty of the block starting a fee
+// window at startHeight, consulting t.feeWindowCache first.
+//
+// If tipUnchanged is true (the chain tip is the same as it was on the
+// previous call to findClosestFeeWindows), a cache hit is trusted without
+// re-validating the hash at startHeight: nothing below an unchanged tip can
+// have reorged, so this skips the per-window GetBlockHash call entirely and
+// makes the whole windowsToConsider loop O(1) in RPCs once the cache is
+// warm. If the tip has moved, each window's hash is re-checked against the
+// chain and any entry whose block was replaced is evicted and refetched.
+func (t *TicketPurchaser) windowDifficulty(startHeight int64, tipUnchanged bool) (hcutil.Amount, error) {
+	if t.feeWindowCache == nil {
+		t.feeWindowCache = make(map[int64]*feeWindowDiff)
+	}
+
+	if windowDiffAmt, ok := warmWindowCacheHit(t.feeWindowCache, startHeight, tipUnchanged); ok {
+		return windowDiffAmt, nil
+	}
+
+	curHash, err := t.hcdChainSvr.GetBlockHash(startHeight)
+	if err != nil {
+		return 0, err
+	}
+
+	if windowDiffAmt, ok := lookupWindowDiff(t.feeWindowCache, startHeight, *curHash); ok {
+		return windowDiffAmt, nil
+	}
+
+	blkHeader, err := t.hcdChainSvr.GetBlockHeader(curHash)
+	if err != nil {
+		return 0, err
+	}
+
+	windowDiffAmt := hcutil.Amount(blkHeader.SBits)
+	t.feeWindowCache[startHeight] = &feeWindowDiff{
+		hash:          *curHash,
+		windowDiffAmt: windowDiffAmt,
+	}
+	return windowDiffAmt, nil
+}
+
+// warmWindowCacheHit returns the cached difficulty for startHeight without
+// touching the chain at all, but only when tipUnchanged is true: nothing
+// below an unchanged tip can have reorged, so a cache entry can be trusted
+// without re-validating its hash. This is what makes windowDifficulty O(1)
+// in RPCs per window once the cache is warm and the tip is stable, rather
+// than merely halving the RPC count every call.
+func warmWindowCacheHit(cache map[int64]*feeWindowDiff, startHeight int64, tipUnchanged bool) (hcutil.Amount, bool) {
+	if !tipUnchanged {
+		return 0, false
+	}
+	cached, ok := cache[startHeight]
+	if !ok {
+		return 0, false
+	}
+	return cached.windowDiffAmt, true
+}
+
+// lookupWindowDiff returns the cached difficulty for startHeight if the
+// cache holds an entry whose hash still matches curHash. If the cache holds
+// a stale entry (curHash has changed, e.g. due to a reorg), it is evicted
+// so that windowDifficulty refetches it from the chain.
+func lookupWindowDiff(cache map[int64]*feeWindowDiff, startHeight int64, curHash chainhash.Hash) (hcutil.Amount, bool) {
+	cached, ok := cache[startHeight]
+	if !ok {
+		return 0, false
+	}
+	if cached.hash == curHash {
+		return cached.windowDiffAmt, true
+	}
+	delete(cache, startHeight)
+	return 0, false
+}
+
+// pruneWindowCache evicts any entry whose start height is not among
+// validStartHeights, i.e. is no longer one of the windowsToConsider windows
+// TicketFeeInfo most recently reported. This keeps t.feeWindowCache bounded
+// instead of growing by one entry per newly-seen window for the life of a
+// long-running ticket buyer.
+func pruneWindowCache(cache map[int64]*feeWindowDiff, validStartHeights map[int64]struct{}) {
+	for h := range cache {
+		if _, ok := validStartHeights[h]; !ok {
+			delete(cache, h)
+		}
+	}
+}
+
+// tipHeight returns the height of the current best block, shared by every
+// fee estimation mode that needs to walk back some number of blocks from
+// the tip (findTicketFeeBlocks, findVWAPTicketFee, EstimateFeePercentiles).
+func (t *TicketPurchaser) tipHeight() (int64, error) {
+	tipHash, err := t.hcdChainSvr.GetBestBlockHash()
+	if err != nil {
+		return 0, err
+	}
+	tipHeader, err := t.hcdChainSvr.GetBlockHeader(tipHash)
+	if err != nil {
+		return 0, err
+	}
+	return int64(tipHeader.Height), nil
+}
+
 // findClosestFeeWindows is used when there is not enough block information
 // from recent blocks to figure out what to set the user's ticket fees to.
 // Instead, it uses data from the last windowsToConsider many windows and
 // takes an average fee from the closest one.
 func (t *TicketPurchaser) findClosestFeeWindows(difficulty hcutil.Amount,
 	useMedian bool) (hcutil.Amount, error) {
+	tipHash, err := t.hcdChainSvr.GetBestBlockHash()
+	if err != nil {
+		return 0, err
+	}
+	tipUnchanged := t.feeWindowTip != nil && *t.feeWindowTip == *tipHash
+	t.feeWindowTip = tipHash
+
 	wtcUint32 := uint32(windowsToConsider)
 	info, err := t.hcdChainSvr.TicketFeeInfo(&zeroUint32, &wtcUint32)
 	if err != nil {
@@ -54,6 +171,12 @@ func (t *TicketPurchaser) findClosestFeeWindows(difficulty hcutil.Amount,
 			"available")
 	}
 
+	validStartHeights := make(map[int64]struct{}, len(info.FeeInfoWindows))
+	for i := range info.FeeInfoWindows {
+		validStartHeights[int64(info.FeeInfoWindows[i].StartHeight)] = struct{}{}
+	}
+	pruneWindowCache(t.feeWindowCache, validStartHeights)
+
 	// Fetch all the mean fees and window difficulties. Calculate
 	// the difference from the current window and sort, then use
 	// the mean fee from the period that has the closest difficulty.
@@ -67,17 +190,11 @@ func (t *TicketPurchaser) findClosestFeeWindows(difficulty hcutil.Amount,
 		}
 
 		startHeight := int64(info.FeeInfoWindows[i].StartHeight)
-		blH, err := t.hcdChainSvr.GetBlockHash(startHeight)
-		if err != nil {
-			return 0, err
-		}
-		blkHeader, err := t.hcdChainSvr.GetBlockHeader(blH)
+		windowDiffAmt, err := t.windowDifficulty(startHeight, tipUnchanged)
 		if err != nil {
 			return 0, err
 		}
 
-		windowDiffAmt := hcutil.Amount(blkHeader.SBits)
-
 		var fee hcutil.Amount
 		if !useMedian {
 			fee, err = hcutil.NewAmount(info.FeeInfoWindows[i].Mean)
@@ -118,27 +235,38 @@ func (t *TicketPurchaser) findClosestFeeWindows(difficulty hcutil.Amount,
 	return sortable[0].fee, nil
 }
 
-// findMeanTicketFeeBlocks finds the mean of the mean of fees from BlocksToAvg
-// many blocks using the ticketfeeinfo RPC API.
+// findTicketFeeBlocks finds the mean of the mean (or median) of fees
+// from BlocksToAvg many blocks, using the cached BlockStats aggregator
+// instead of the ticketfeeinfo RPC so the same per-block walk can also
+// feed the VWAP and percentile fee estimation modes.
 func (t *TicketPurchaser) findTicketFeeBlocks(useMedian bool) (hcutil.Amount, error) {
-	btaUint32 := uint32(t.cfg.BlocksToAvg)
-	info, err := t.hcdChainSvr.TicketFeeInfo(&btaUint32, nil)
+	tipHeight, err := t.tipHeight()
 	if err != nil {
-		return 0.0, err
+		return 0, err
 	}
 
-	var sum, tmp hcutil.Amount
-	for i := range info.FeeInfoBlocks {
-		if !useMedian {
-			tmp, err = hcutil.NewAmount(info.FeeInfoBlocks[i].Mean)
-		} else {
-			tmp, err = hcutil.NewAmount(info.FeeInfoBlocks[i].Median)
-		}
+	blocksToAvg := int64(t.cfg.BlocksToAvg)
+	var sum hcutil.Amount
+	var count int64
+	for h := tipHeight; h > tipHeight-blocksToAvg && h >= 0; h-- {
+		stats, err := t.blockStats(h)
 		if err != nil {
 			return 0, err
 		}
-		sum += tmp
+		if stats.TicketMeanFeeRate == 0 && stats.TicketMedianFeeRate == 0 {
+			continue
+		}
+		if !useMedian {
+			sum += stats.TicketMeanFeeRate
+		} else {
+			sum += stats.TicketMedianFeeRate
+		}
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil
 	}
 
-	return sum / hcutil.Amount(t.cfg.BlocksToAvg), nil
+	return sum / hcutil.Amount(count), nil
 }
@@ -0,0 +1,94 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import (
+	"testing"
+
+	"github.com/HcashOrg/hcd/chaincfg/chainhash"
+	"github.com/HcashOrg/hcd/hcutil"
+)
+
+func TestLookupWindowDiff(t *testing.T) {
+	origHash := chainhash.Hash{0x01}
+	cache := map[int64]*feeWindowDiff{
+		100: {hash: origHash, windowDiffAmt: hcutil.Amount(5000)},
+	}
+
+	// A hit: the chain at this height still has the hash we cached.
+	got, ok := lookupWindowDiff(cache, 100, origHash)
+	if !ok || got != hcutil.Amount(5000) {
+		t.Fatalf("expected cache hit with amount 5000, got %v, ok=%v", got, ok)
+	}
+	if _, stillPresent := cache[100]; !stillPresent {
+		t.Fatalf("cache hit should not evict the entry")
+	}
+
+	// A reorg: the hash at this height has changed, so the stale entry
+	// must be evicted and reported as a miss.
+	reorgHash := chainhash.Hash{0x02}
+	got, ok = lookupWindowDiff(cache, 100, reorgHash)
+	if ok {
+		t.Fatalf("expected cache miss after reorg, got hit with amount %v", got)
+	}
+	if _, stillPresent := cache[100]; stillPresent {
+		t.Fatalf("reorg should evict the stale cache entry")
+	}
+
+	// A miss on a height that was never cached.
+	if _, ok := lookupWindowDiff(cache, 200, origHash); ok {
+		t.Fatalf("expected cache miss for an uncached height")
+	}
+}
+
+func TestWarmWindowCacheHit(t *testing.T) {
+	cache := map[int64]*feeWindowDiff{
+		100: {windowDiffAmt: hcutil.Amount(5000)},
+	}
+
+	// The whole point of this helper is that it never needs to revalidate
+	// a hash (i.e. never needs a GetBlockHash call) as long as the tip
+	// hasn't moved since the last call.
+	got, ok := warmWindowCacheHit(cache, 100, true)
+	if !ok || got != hcutil.Amount(5000) {
+		t.Fatalf("expected a warm hit with amount 5000, got %v, ok=%v", got, ok)
+	}
+
+	// If the tip has moved, the cache can't be trusted without
+	// revalidating, so this must always report a miss.
+	if _, ok := warmWindowCacheHit(cache, 100, false); ok {
+		t.Fatalf("expected a miss when tipUnchanged is false")
+	}
+
+	// A height with no cache entry is always a miss, tip or no tip.
+	if _, ok := warmWindowCacheHit(cache, 200, true); ok {
+		t.Fatalf("expected a miss for an uncached height")
+	}
+}
+
+func TestPruneWindowCache(t *testing.T) {
+	cache := map[int64]*feeWindowDiff{
+		100: {},
+		200: {},
+		300: {},
+	}
+	validStartHeights := map[int64]struct{}{
+		200: {},
+		300: {},
+	}
+
+	pruneWindowCache(cache, validStartHeights)
+
+	if _, ok := cache[100]; ok {
+		t.Errorf("height 100 is no longer a reported window and should have been pruned")
+	}
+	if _, ok := cache[200]; !ok {
+		t.Errorf("height 200 is still a reported window and should remain")
+	}
+	if _, ok := cache[300]; !ok {
+		t.Errorf("height 300 is still a reported window and should remain")
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/HcashOrg/hcd/blockchain/stake"
+	"github.com/HcashOrg/hcd/chaincfg/chainhash"
+	"github.com/HcashOrg/hcd/hcutil"
+)
+
+// feeHistoryBlock holds the per-transaction fee-per-kB weights observed in
+// a single block, along with the hash it was computed from so that a reorg
+// can be detected cheaply by comparing against the current chain.
+type feeHistoryBlock struct {
+	hash       chainhash.Hash
+	height     int64
+	fees       feeWeights
+	ticketFees feeWeights
+	txs        int
+	ins        int
+	outs       int
+}
+
+// feeWeight pairs a transaction's fee rate with the weight (size in bytes)
+// that it contributes to a block, so that percentiles can be computed over
+// block weight rather than transaction count.
+type feeWeight struct {
+	feePerKB hcutil.Amount
+	size     int64
+}
+
+// feeWeights is a slice type definition used to satisfy the sorting
+// interface and to accumulate weight across many blocks.
+type feeWeights []feeWeight
+
+func (w feeWeights) Len() int           { return len(w) }
+func (w feeWeights) Less(i, j int) bool { return w[i].feePerKB < w[j].feePerKB }
+func (w feeWeights) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+
+// feeHistoryCache caches feeHistoryBlock entries by height so that
+// EstimateFeePercentiles does not need to refetch and recompute fee weights
+// for blocks it has already seen in a previous window.
+//
+// Computing a transaction's fee requires looking up the value of every
+// input's previous output via GetRawTransaction, which on a hcd-family node
+// only succeeds for already-spent outputs when the node was started with
+// --txindex. Without it, GetRawTransaction returns an error for any input
+// whose previous output has already been spent, and that error is
+// propagated rather than swallowed so that running without a transaction
+// index fails loudly instead of quietly zeroing out fee samples.
+//
+// t.feeHistoryCacheMaxHeight tracks the highest height ever requested so
+// entries that have aged out of the window of interest can be pruned
+// (see pruneHeightCache), keeping the cache from growing without bound as
+// the chain tip advances over a long-running process.
+func (t *TicketPurchaser) feeHistoryCacheEntry(height int64) (*feeHistoryBlock, error) {
+	if t.feeHistoryCache == nil {
+		t.feeHistoryCache = make(map[int64]*feeHistoryBlock)
+	}
+	if height > t.feeHistoryCacheMaxHeight {
+		t.feeHistoryCacheMaxHeight = height
+	}
+	pruneHeightCache(t.feeHistoryCache, t.feeHistoryCacheMaxHeight)
+
+	curHash, err := t.hcdChainSvr.GetBlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+
+	// A cached entry is only valid if the hash at this height still
+	// matches what we cached it under; otherwise a reorg has replaced
+	// the block and the entry must be dropped.
+	if cached, ok := t.feeHistoryCache[height]; ok {
+		if cached.hash == *curHash {
+			return cached, nil
+		}
+		delete(t.feeHistoryCache, height)
+	}
+
+	blk, err := t.hcdChainSvr.GetBlock(curHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var fees, ticketFees feeWeights
+	var ins, outs int
+	for i, tx := range blk.Transactions {
+		ins += len(tx.MsgTx().TxIn)
+		outs += len(tx.MsgTx().TxOut)
+
+		// The first transaction in a block is always the coinbase,
+		// which has no real inputs to compute a fee from; including
+		// it would add a spurious feePerKB=0 sample to every block.
+		if i == 0 {
+			continue
+		}
+		fw, err := t.txFeeWeight(tx)
+		if err != nil {
+			return nil, fmt.Errorf("computing fee for transaction %v in "+
+				"block %v (requires --txindex): %v", tx.Hash(), *curHash, err)
+		}
+		fees = append(fees, fw)
+	}
+	for _, stx := range blk.STransactions {
+		ins += len(stx.MsgTx().TxIn)
+		outs += len(stx.MsgTx().TxOut)
+
+		fw, err := t.txFeeWeight(stx)
+		if err != nil {
+			return nil, fmt.Errorf("computing fee for transaction %v in "+
+				"block %v (requires --txindex): %v", stx.Hash(), *curHash, err)
+		}
+		fees = append(fees, fw)
+		if isTicketPurchase(stx) {
+			ticketFees = append(ticketFees, fw)
+		}
+	}
+
+	entry := &feeHistoryBlock{
+		hash:       *curHash,
+		height:     height,
+		fees:       fees,
+		ticketFees: ticketFees,
+		txs:        len(blk.Transactions) + len(blk.STransactions),
+		ins:        ins,
+		outs:       outs,
+	}
+	t.feeHistoryCache[height] = entry
+	return entry, nil
+}
+
+// pruneHeightCache evicts any entry keyed below maxHeight-windowsToConsider,
+// so that a long-running ticket buyer loop doesn't grow caches keyed by
+// height without bound as the chain tip advances.
+func pruneHeightCache(cache map[int64]*feeHistoryBlock, maxHeight int64) {
+	cutoff := maxHeight - windowsToConsider
+	for h := range cache {
+		if h < cutoff {
+			delete(cache, h)
+		}
+	}
+}
+
+// EstimateFeePercentiles mirrors the eth_feeHistory algorithm used by
+// go-ethereum's gas price oracle: it walks the last blocks many blocks,
+// collects the fee-per-kB of every regular and stake transaction weighted
+// by transaction size, and for each requested percentile returns the
+// fee-per-kB at which that percentage of block weight was paid at or
+// below. This produces a much smoother, less manipulable fee target than
+// the raw mean/median already used by findTicketFeeBlocks.
+func (t *TicketPurchaser) EstimateFeePercentiles(blocks int, percentiles []float64) ([]hcutil.Amount, error) {
+	if blocks <= 0 {
+		blocks = windowsToConsider
+	}
+
+	tipHeight, err := t.tipHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	var all feeWeights
+	for h := tipHeight; h > tipHeight-int64(blocks) && h >= 0; h-- {
+		entry, err := t.feeHistoryCacheEntry(h)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entry.fees...)
+	}
+
+	if len(all) == 0 {
+		return nil, fmt.Errorf("not enough transactions in the last %d "+
+			"blocks to estimate fee percentiles", blocks)
+	}
+
+	return weightedFeePercentiles(all, percentiles), nil
+}
+
+// weightedFeePercentiles sorts weights by feePerKB and, for each requested
+// percentile p, returns the feePerKB at which p% of the total size-weighted
+// mass has been accumulated at or below. weights is sorted in place.
+func weightedFeePercentiles(weights feeWeights, percentiles []float64) []hcutil.Amount {
+	sort.Sort(weights)
+
+	var totalWeight int64
+	for _, fw := range weights {
+		totalWeight += fw.size
+	}
+
+	results := make([]hcutil.Amount, len(percentiles))
+	for i, p := range percentiles {
+		target := p / 100 * float64(totalWeight)
+		var cumulative int64
+		fee := weights[len(weights)-1].feePerKB
+		for _, fw := range weights {
+			cumulative += fw.size
+			if float64(cumulative) >= target {
+				fee = fw.feePerKB
+				break
+			}
+		}
+		results[i] = fee
+	}
+
+	return results
+}
+
+// isTicketPurchase reports whether tx is a ticket purchase (SStx).
+func isTicketPurchase(tx *hcutil.Tx) bool {
+	return stake.IsSStx(tx.MsgTx())
+}
+
+// txFeeWeight computes the fee-per-kB paid by tx along with its serialized
+// size, which together make up one weighted sample for EstimateFeePercentiles.
+//
+// This requires fetching every input's previous output via GetRawTransaction,
+// which in turn requires the connected hcd node to be running with
+// --txindex; without it, lookups of already-spent outputs fail and that
+// failure is returned to the caller rather than dropped.
+func (t *TicketPurchaser) txFeeWeight(tx *hcutil.Tx) (feeWeight, error) {
+	msgTx := tx.MsgTx()
+
+	var in hcutil.Amount
+	for _, txIn := range msgTx.TxIn {
+		if txIn.PreviousOutPoint.Hash == (chainhash.Hash{}) {
+			// Coinbase/stakebase input; no real previous output to fetch.
+			continue
+		}
+		prev, err := t.hcdChainSvr.GetRawTransaction(&txIn.PreviousOutPoint.Hash)
+		if err != nil {
+			return feeWeight{}, err
+		}
+		prevOuts := prev.MsgTx().TxOut
+		if int(txIn.PreviousOutPoint.Index) >= len(prevOuts) {
+			return feeWeight{}, fmt.Errorf("outpoint index out of range "+
+				"for transaction %v", txIn.PreviousOutPoint.Hash)
+		}
+		in += hcutil.Amount(prevOuts[txIn.PreviousOutPoint.Index].Value)
+	}
+
+	var out hcutil.Amount
+	for _, txOut := range msgTx.TxOut {
+		out += hcutil.Amount(txOut.Value)
+	}
+
+	fee := in - out
+	if fee < 0 {
+		fee = 0
+	}
+
+	size := int64(msgTx.SerializeSize())
+	if size == 0 {
+		return feeWeight{}, fmt.Errorf("transaction has zero size")
+	}
+
+	feePerKB := hcutil.Amount(float64(fee) / (float64(size) / 1000))
+	return feeWeight{feePerKB: feePerKB, size: size}, nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import (
+	"testing"
+
+	"github.com/HcashOrg/hcd/hcutil"
+)
+
+func TestWeightedFeePercentiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		weights     feeWeights
+		percentiles []float64
+		want        []hcutil.Amount
+	}{
+		{
+			name: "evenly sized samples",
+			weights: feeWeights{
+				{feePerKB: 10, size: 250},
+				{feePerKB: 20, size: 250},
+				{feePerKB: 30, size: 250},
+				{feePerKB: 40, size: 250},
+			},
+			percentiles: []float64{20, 50, 80},
+			want:        []hcutil.Amount{10, 20, 40},
+		},
+		{
+			name: "one large sample dominates the weight",
+			weights: feeWeights{
+				{feePerKB: 5, size: 900},
+				{feePerKB: 100, size: 100},
+			},
+			percentiles: []float64{50, 95},
+			want:        []hcutil.Amount{5, 100},
+		},
+		{
+			name: "single sample returns itself for every percentile",
+			weights: feeWeights{
+				{feePerKB: 42, size: 500},
+			},
+			percentiles: []float64{10, 50, 90},
+			want:        []hcutil.Amount{42, 42, 42},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := weightedFeePercentiles(test.weights, test.percentiles)
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d results, want %d", len(got), len(test.want))
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("percentile %v: got %v, want %v",
+						test.percentiles[i], got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPruneHeightCache(t *testing.T) {
+	cache := map[int64]*feeHistoryBlock{
+		50:  {height: 50},
+		79:  {height: 79},
+		80:  {height: 80},
+		100: {height: 100},
+	}
+
+	// maxHeight=100 with windowsToConsider=20 means a cutoff of 80:
+	// anything below that has aged out of the window of interest.
+	pruneHeightCache(cache, 100)
+
+	if _, ok := cache[50]; ok {
+		t.Errorf("height 50 should have been pruned")
+	}
+	if _, ok := cache[79]; ok {
+		t.Errorf("height 79 should have been pruned")
+	}
+	if _, ok := cache[80]; !ok {
+		t.Errorf("height 80 is exactly at the cutoff and should remain")
+	}
+	if _, ok := cache[100]; !ok {
+		t.Errorf("the current height should remain")
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/HcashOrg/hcd/hcutil"
+)
+
+const (
+	// defaultFeeProviderTimeout is how long to wait for the external fee
+	// endpoint to respond before falling back to the on-chain estimate.
+	defaultFeeProviderTimeout = 5 * time.Second
+
+	// defaultFeeProviderTTL is how long a successful response from the
+	// external fee endpoint is considered fresh.
+	defaultFeeProviderTTL = 2 * time.Minute
+)
+
+// FeeProvider is implemented by anything that can suggest a ticket fee.
+// It allows operators to plug in an alternative, HTTP-based fee oracle
+// (analogous to Blockbook's mempool.space integration) alongside the
+// on-chain fee paths: the BlockStats-derived findTicketFeeBlocks and the
+// TicketFeeInfo-based findClosestFeeWindows.
+type FeeProvider interface {
+	// SuggestFee returns a suggested ticket fee, or an error if the
+	// provider has no usable suggestion.
+	SuggestFee() (hcutil.Amount, error)
+}
+
+// httpFeeResponse is the expected JSON shape returned by the configured
+// fee endpoint.
+type httpFeeResponse struct {
+	FeePerKB float64 `json:"feePerKB"`
+}
+
+// httpFeeProvider queries a configurable JSON endpoint on demand and caches
+// the last successful response for defaultFeeProviderTTL; there is no
+// background polling. When the cached response is stale, SuggestFee polls
+// again; only when that poll fails does it fall back to the purchaser's
+// on-chain fee estimate.
+type httpFeeProvider struct {
+	t        *TicketPurchaser
+	url      string
+	client   *http.Client
+	lastFee  hcutil.Amount
+	lastPoll time.Time
+}
+
+// newHTTPFeeProvider returns a FeeProvider that queries url on demand,
+// falling back to t's on-chain fee estimate when the endpoint is stale or
+// errors out.
+func newHTTPFeeProvider(t *TicketPurchaser, url string) FeeProvider {
+	return &httpFeeProvider{
+		t:   t,
+		url: url,
+		client: &http.Client{
+			Timeout: defaultFeeProviderTimeout,
+		},
+	}
+}
+
+// SuggestFee returns the cached fee from the external endpoint if it is
+// still fresh, polling the endpoint otherwise. After a successful poll it
+// logs a comparison with the on-chain findTicketFeeBlocks estimate for
+// auditability. If the poll fails, it logs a warning and falls back to the
+// on-chain findTicketFeeBlocks mean estimate.
+func (p *httpFeeProvider) SuggestFee() (hcutil.Amount, error) {
+	if time.Since(p.lastPoll) < defaultFeeProviderTTL && p.lastFee != 0 {
+		return p.lastFee, nil
+	}
+
+	fee, err := p.poll()
+	if err != nil {
+		log.Warnf("external fee provider %s unavailable (%v), falling "+
+			"back to on-chain fee estimate", p.url, err)
+		if p.t == nil {
+			return 0, err
+		}
+		return p.t.findTicketFeeBlocks(false)
+	}
+
+	p.lastFee = fee
+	p.lastPoll = time.Now()
+
+	// Only computed on a cache miss, since findTicketFeeBlocks can walk
+	// several blocks' worth of transactions; this is purely for the
+	// auditability log below, not for the returned value.
+	if p.t != nil {
+		if onChainFee, onChainErr := p.t.findTicketFeeBlocks(false); onChainErr == nil {
+			log.Debugf("external fee provider suggests %v, on-chain "+
+				"estimate is %v", fee, onChainFee)
+		}
+	}
+
+	return fee, nil
+}
+
+// feeProvider returns the purchaser's configured FeeProvider, constructing
+// it the first time it is needed from cfg.TicketFeeProviderURL. If no URL
+// is configured, it returns nil and callers should use the on-chain
+// estimate directly.
+func (t *TicketPurchaser) feeProvider() FeeProvider {
+	if t.cfg.TicketFeeProviderURL == "" {
+		return nil
+	}
+	if t.feeProviderInst == nil {
+		t.feeProviderInst = newHTTPFeeProvider(t, t.cfg.TicketFeeProviderURL)
+	}
+	return t.feeProviderInst
+}
+
+// poll queries the configured endpoint for the current suggested fee.
+func (p *httpFeeProvider) poll() (hcutil.Amount, error) {
+	resp, err := p.client.Get(p.url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fee provider returned status %d", resp.StatusCode)
+	}
+
+	var fr httpFeeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&fr); err != nil {
+		return 0, err
+	}
+
+	return hcutil.NewAmount(fr.FeePerKB)
+}
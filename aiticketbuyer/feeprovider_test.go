@@ -0,0 +1,127 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/HcashOrg/hcd/hcutil"
+)
+
+func TestHTTPFeeProviderPoll(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		wantFee    hcutil.Amount
+		wantErr    bool
+	}{
+		{
+			name:       "valid response",
+			body:       `{"feePerKB": 0.0001}`,
+			statusCode: http.StatusOK,
+			wantFee:    10000,
+		},
+		{
+			name:       "non-200 status",
+			body:       `{"feePerKB": 0.0001}`,
+			statusCode: http.StatusInternalServerError,
+			wantErr:    true,
+		},
+		{
+			name:       "malformed json",
+			body:       `not json`,
+			statusCode: http.StatusOK,
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.statusCode)
+				w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			p := &httpFeeProvider{
+				url:    srv.URL,
+				client: srv.Client(),
+			}
+			fee, err := p.poll()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got nil error, want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fee != test.wantFee {
+				t.Errorf("got fee %v, want %v", fee, test.wantFee)
+			}
+		})
+	}
+}
+
+func TestSuggestFeeWarmCache(t *testing.T) {
+	p := &httpFeeProvider{
+		lastFee:  12345,
+		lastPoll: time.Now(),
+	}
+	fee, err := p.SuggestFee()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fee != 12345 {
+		t.Errorf("got fee %v, want %v", fee, p.lastFee)
+	}
+}
+
+func TestSuggestFeeStaleCachePolls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"feePerKB": 0.0002}`))
+	}))
+	defer srv.Close()
+
+	p := &httpFeeProvider{
+		url:    srv.URL,
+		client: srv.Client(),
+	}
+	fee, err := p.SuggestFee()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := hcutil.Amount(20000)
+	if fee != want {
+		t.Errorf("got fee %v, want %v", fee, want)
+	}
+	if p.lastFee != want {
+		t.Errorf("lastFee not cached: got %v, want %v", p.lastFee, want)
+	}
+	if p.lastPoll.IsZero() {
+		t.Errorf("lastPoll was not updated")
+	}
+}
+
+func TestSuggestFeePollFailureWithoutFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	p := &httpFeeProvider{
+		url:    srv.URL,
+		client: srv.Client(),
+	}
+	if _, err := p.SuggestFee(); err == nil {
+		t.Fatalf("got nil error, want the poll failure surfaced since p.t is nil")
+	}
+}
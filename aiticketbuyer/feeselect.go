@@ -0,0 +1,91 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import "github.com/HcashOrg/hcd/hcutil"
+
+// Fee estimation modes selectable via cfg.FeeEstimationMode.
+const (
+	// FeeEstimationModeMean uses the mean ticket fee of the last
+	// BlocksToAvg blocks.
+	FeeEstimationModeMean = "mean"
+
+	// FeeEstimationModeMedian uses the median ticket fee of the last
+	// BlocksToAvg blocks.
+	FeeEstimationModeMedian = "median"
+
+	// FeeEstimationModeFeeHistory uses the median of the weighted fee
+	// percentiles produced by EstimateFeePercentiles.
+	FeeEstimationModeFeeHistory = "feeHistory"
+
+	// FeeEstimationModeVWAP uses the volume-weighted average ticket fee
+	// produced by findVWAPTicketFee.
+	FeeEstimationModeVWAP = "vwap"
+)
+
+// findTicketFee is the single entry point the ticket buying loop should
+// call to get a fee-per-kB to use for the next ticket purchase. If an
+// external FeeProvider is configured via cfg.TicketFeeProviderURL, its
+// suggestion is preferred; otherwise the fee is estimated on-chain using
+// whichever strategy cfg.FeeEstimationMode selects, falling back to
+// findClosestFeeWindows when there isn't enough recent block information
+// to produce an estimate.
+func (t *TicketPurchaser) findTicketFee(difficulty hcutil.Amount) (hcutil.Amount, error) {
+	if fp := t.feeProvider(); fp != nil {
+		fee, err := fp.SuggestFee()
+		if err == nil && fee != 0 {
+			return fee, nil
+		}
+		log.Warnf("fee provider returned no usable fee (%v), falling "+
+			"back to on-chain estimation mode %q", err, t.cfg.FeeEstimationMode)
+	}
+
+	switch t.cfg.FeeEstimationMode {
+	case FeeEstimationModeMedian:
+		fee, err := t.findTicketFeeBlocks(true)
+		if err == nil && fee != 0 {
+			return fee, nil
+		}
+		logFeeEstimationFallback(t.cfg.FeeEstimationMode, err)
+		return t.findClosestFeeWindows(difficulty, true)
+
+	case FeeEstimationModeFeeHistory:
+		fees, err := t.EstimateFeePercentiles(windowsToConsider, []float64{50})
+		if err == nil && len(fees) > 0 && fees[0] != 0 {
+			return fees[0], nil
+		}
+		logFeeEstimationFallback(t.cfg.FeeEstimationMode, err)
+		return t.findClosestFeeWindows(difficulty, false)
+
+	case FeeEstimationModeVWAP:
+		fee, err := t.findVWAPTicketFee(uint32(t.cfg.BlocksToAvg))
+		if err == nil && fee != 0 {
+			return fee, nil
+		}
+		logFeeEstimationFallback(t.cfg.FeeEstimationMode, err)
+		return t.findClosestFeeWindows(difficulty, false)
+
+	default:
+		fee, err := t.findTicketFeeBlocks(false)
+		if err == nil && fee != 0 {
+			return fee, nil
+		}
+		logFeeEstimationFallback(t.cfg.FeeEstimationMode, err)
+		return t.findClosestFeeWindows(difficulty, false)
+	}
+}
+
+// logFeeEstimationFallback warns when findTicketFee falls back to
+// findClosestFeeWindows because the preferred estimation mode returned an
+// error. Without this, an error such as a missing --txindex (propagated by
+// txFeeWeight/feeHistoryCacheEntry) would silently downgrade fee estimation
+// to the windowed fallback on every call without ever surfacing why.
+func logFeeEstimationFallback(mode string, err error) {
+	if err != nil {
+		log.Warnf("fee estimation mode %q failed (%v), falling back to "+
+			"windowed fee estimate", mode, err)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import (
+	"fmt"
+
+	"github.com/HcashOrg/hcd/hcutil"
+)
+
+// findVWAPTicketFee fetches the ticket purchase transactions from the last
+// blocks many blocks and computes a volume-weighted average fee: each
+// ticket's fee is weighted by its purchase price (SBits), so that tickets
+// which cleared at high prices count for more than low-price outliers that
+// may be left over from a stale window. This mirrors dcrd's
+// ticketvwap/txfeeinfo commands and gives a fee estimate that reacts faster
+// to a rapidly-changing stake difficulty than a plain mean or median.
+// Selectable via cfg.FeeEstimationMode = FeeEstimationModeVWAP in
+// findTicketFee.
+func (t *TicketPurchaser) findVWAPTicketFee(blocks uint32) (hcutil.Amount, error) {
+	tipHeight, err := t.tipHeight()
+	if err != nil {
+		return 0, err
+	}
+
+	var samples []vwapSample
+	for h := tipHeight; h > tipHeight-int64(blocks) && h >= 0; h-- {
+		entry, err := t.feeHistoryCacheEntry(h)
+		if err != nil {
+			return 0, err
+		}
+		if len(entry.ticketFees) == 0 {
+			continue
+		}
+
+		// findVWAPTicketFee doesn't track tip movement across calls the
+		// way findClosestFeeWindows does, so always validate the cache
+		// entry's hash here.
+		windowDiffAmt, err := t.windowDifficulty(h, false)
+		if err != nil {
+			return 0, err
+		}
+		price := float64(windowDiffAmt)
+		if price <= 0 {
+			continue
+		}
+
+		for _, fw := range entry.ticketFees {
+			samples = append(samples, vwapSample{fee: fw.feePerKB, price: price})
+		}
+	}
+
+	fee, ok := vwapFee(samples)
+	if !ok {
+		return 0, fmt.Errorf("not enough ticket data in the last %d "+
+			"blocks to compute a volume-weighted fee", blocks)
+	}
+
+	return fee, nil
+}
+
+// vwapSample is one ticket's fee-per-kB paired with the price (SBits) it
+// purchased at.
+type vwapSample struct {
+	fee   hcutil.Amount
+	price float64
+}
+
+// vwapFee computes sum(fee_i * price_i) / sum(price_i) over samples. It
+// returns ok=false if there is nothing to average, e.g. an empty sample set
+// or one whose prices are all zero.
+func vwapFee(samples []vwapSample) (hcutil.Amount, bool) {
+	var feeTimesPrice, priceSum float64
+	for _, s := range samples {
+		feeTimesPrice += float64(s.fee) * s.price
+		priceSum += s.price
+	}
+
+	if len(samples) == 0 || priceSum == 0 {
+		return 0, false
+	}
+
+	return hcutil.Amount(feeTimesPrice / priceSum), true
+}
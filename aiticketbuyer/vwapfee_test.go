@@ -0,0 +1,65 @@
+// Copyright (c) 2016 The Decred developers
+// Copyright (c) 2018-2020 The Hc developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package aiticketbuyer
+
+import (
+	"testing"
+
+	"github.com/HcashOrg/hcd/hcutil"
+)
+
+func TestVWAPFee(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []vwapSample
+		wantFee hcutil.Amount
+		wantOK  bool
+	}{
+		{
+			name:    "no samples",
+			samples: nil,
+			wantOK:  false,
+		},
+		{
+			name: "equal prices reduces to a plain average",
+			samples: []vwapSample{
+				{fee: 10, price: 100},
+				{fee: 20, price: 100},
+			},
+			wantFee: 15,
+			wantOK:  true,
+		},
+		{
+			name: "high-price ticket dominates the average",
+			samples: []vwapSample{
+				{fee: 10, price: 10},
+				{fee: 100, price: 990},
+			},
+			wantFee: 99, // (10*10 + 100*990) / 1000 = 99.1, truncated
+			wantOK:  true,
+		},
+		{
+			name: "all zero prices is treated as no data",
+			samples: []vwapSample{
+				{fee: 10, price: 0},
+				{fee: 20, price: 0},
+			},
+			wantOK: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fee, ok := vwapFee(test.samples)
+			if ok != test.wantOK {
+				t.Fatalf("got ok=%v, want %v", ok, test.wantOK)
+			}
+			if ok && fee != test.wantFee {
+				t.Errorf("got fee %v, want %v", fee, test.wantFee)
+			}
+		})
+	}
+}